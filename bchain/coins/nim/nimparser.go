@@ -2,7 +2,12 @@ package nim
 
 import (
 	"blockbook/bchain"
+	"encoding/binary"
+	"encoding/hex"
+	"github.com/juju/errors"
 	"math/big"
+	"strconv"
+	"strings"
 )
 
 // NimiqTypeAddressDescriptorLen - in case of NimiqType, the AddressDescriptor has fixed length
@@ -11,6 +16,15 @@ const NimiqTypeAddressDescriptorLen = 20
 // NimiqAmountDecimalPoint defines number of decimal points in Nimiq amounts
 const EtherAmountDecimalPoint = 5
 
+// nimAddressAlphabet is the base32 alphabet used by Nimiq's user-friendly
+// "NQ" address format, it omits the letters I, O, W and Z
+const nimAddressAlphabet = "0123456789ABCDEFGHJKLMNPQRSTUVXY"
+
+// nimiqTxFixedRecordLen is the length in bytes of the fixed-size portion of
+// a packed Nimiq tx record. It is followed by two length-prefixed variable
+// sections holding the raw Data and Proof payloads, see PackTx
+const nimiqTxFixedRecordLen = 4 + 8 + 4 + 4 + 8 + 8 + 8 + 4 + 4 + 4 + 4 + 4 + 32 + 32 + NimiqTypeAddressDescriptorLen + NimiqTypeAddressDescriptorLen
+
 // NimiqParser handle
 type NimiqParser struct {
 	*bchain.BaseParser
@@ -49,17 +63,154 @@ type rpcBlock struct {
 }
 
 type rpcTx struct {
-	Hash             string `json:"hash"`
-	BlockHash        string `json:"blockHash"`
-	Timestamp        uint64 `json:"timestamp"`
-	Confirmations    int    `json:"confirmations"`
-	TransactionIndex int    `json:"transactionIndex"`
-	From             string `json:"from"`
-	FromAddress      string `json:"fromAddress"`
-	To               string `json:"to"`
-	ToAddress        string `json:"toAddress"`
-	Value            uint64 `json:"value"`
-	Fee              uint64 `json:"fee"`
+	Hash                string `json:"hash"`
+	BlockHash           string `json:"blockHash"`
+	Timestamp           uint64 `json:"timestamp"`
+	Confirmations       int    `json:"confirmations"`
+	TransactionIndex    int    `json:"transactionIndex"`
+	From                string `json:"from"`
+	FromAddress         string `json:"fromAddress"`
+	To                  string `json:"to"`
+	ToAddress           string `json:"toAddress"`
+	Value               uint64 `json:"value"`
+	Fee                 uint64 `json:"fee"`
+	Flags               int    `json:"flags"`
+	Data                string `json:"data"`
+	Proof               string `json:"proof"`
+	SenderType          int    `json:"senderType"`
+	RecipientType       int    `json:"recipientType"`
+	ValidityStartHeight uint32 `json:"validityStartHeight"`
+	NetworkID           int    `json:"networkId"`
+}
+
+// Nimiq account types, used on RecipientType/SenderType to tell a plain
+// transfer from one touching a vesting contract or an HTLC
+const (
+	nimAccountTypeBasic   = 0
+	nimAccountTypeVesting = 1
+	nimAccountTypeHTLC    = 2
+)
+
+// nimFlagContractCreation marks a transaction that creates a new contract
+// account (vesting or HTLC) rather than transferring to/interacting with an
+// existing one
+const nimFlagContractCreation = 0x1
+
+// nimContractVouts decodes the contract-specific payload of a non-basic
+// Nimiq transaction into pseudo-vouts, so the address index also tracks
+// contract participants (the vesting owner, the HTLC recipient/redeemer)
+// and not just the plain sender/recipient captured by the basic vin/vout
+func nimContractVouts(tx *rpcTx) []bchain.Vout {
+	if tx.Flags&nimFlagContractCreation != 0 {
+		if tx.RecipientType == nimAccountTypeBasic || tx.Data == "" {
+			return nil
+		}
+		data, err := hex.DecodeString(tx.Data)
+		if err != nil {
+			return nil
+		}
+		switch tx.RecipientType {
+		case nimAccountTypeVesting:
+			return nimVestingCreationVouts(data)
+		case nimAccountTypeHTLC:
+			return nimHTLCCreationVouts(data)
+		default:
+			return nil
+		}
+	}
+
+	// not a creation: a tx whose *sender* is an existing contract account
+	// is the contract being interacted with, e.g. claiming vested funds or
+	// redeeming an HTLC
+	return nimContractInteractionVouts(tx)
+}
+
+// nimHTLCProofRegularTransfer identifies the proof variant of an HTLC
+// redemption that spends against the hash-preimage (as opposed to an
+// early/timeout resolution, which is authorized by signature alone and has
+// nothing contract-specific left to surface)
+const nimHTLCProofRegularTransfer = 1
+
+// nimContractInteractionVouts decodes a tx spent from an existing contract
+// account. A vesting claim carries only the owner's signature in Proof and
+// has nothing further to decode; an HTLC regular-transfer redemption proves
+// the hash root it was redeemed against, which is surfaced as a pseudo-vout
+func nimContractInteractionVouts(tx *rpcTx) []bchain.Vout {
+	if tx.SenderType != nimAccountTypeHTLC || tx.Proof == "" {
+		return nil
+	}
+	proof, err := hex.DecodeString(tx.Proof)
+	if err != nil {
+		return nil
+	}
+
+	const (
+		proofTypeOff = 0
+		hashRootOff  = 1 + 1 + 1 // type + hashAlgorithm + hashDepth
+		hashRootLen  = 32
+	)
+	if len(proof) < hashRootOff+hashRootLen || proof[proofTypeOff] != nimHTLCProofRegularTransfer {
+		return nil
+	}
+	hashRoot := proof[hashRootOff : hashRootOff+hashRootLen]
+
+	return []bchain.Vout{
+		{
+			N: 1,
+			ScriptPubKey: bchain.ScriptPubKey{
+				Hex: hex.EncodeToString(hashRoot),
+			},
+		},
+	}
+}
+
+// nimVestingCreationVouts decodes a vesting contract creation payload,
+// surfacing the vesting owner (beneficiary) as a pseudo-vout
+func nimVestingCreationVouts(data []byte) []bchain.Vout {
+	if len(data) < NimiqTypeAddressDescriptorLen {
+		return nil
+	}
+	owner := data[:NimiqTypeAddressDescriptorLen]
+	return []bchain.Vout{
+		{
+			N: 1,
+			ScriptPubKey: bchain.ScriptPubKey{
+				Addresses: []string{formatNimiqAddress(owner)},
+			},
+		},
+	}
+}
+
+// nimHTLCCreationVouts decodes an HTLC contract creation payload
+// (sender, recipient, hash algorithm, hash root, hash count, timeout),
+// surfacing the recipient, the hash root and the timeout as pseudo-vouts
+func nimHTLCCreationVouts(data []byte) []bchain.Vout {
+	const (
+		recipientOff = NimiqTypeAddressDescriptorLen
+		hashRootOff  = recipientOff + NimiqTypeAddressDescriptorLen + 1 // +1 hash algorithm byte
+		hashRootLen  = 32
+		timeoutOff   = hashRootOff + hashRootLen + 1 // +1 hash count byte
+	)
+	if len(data) < timeoutOff+8 {
+		return nil
+	}
+	recipient := data[recipientOff : recipientOff+NimiqTypeAddressDescriptorLen]
+	hashRoot := data[hashRootOff : hashRootOff+hashRootLen]
+	timeout := binary.BigEndian.Uint64(data[timeoutOff : timeoutOff+8])
+
+	return []bchain.Vout{
+		{
+			N: 1,
+			ScriptPubKey: bchain.ScriptPubKey{
+				Addresses: []string{formatNimiqAddress(recipient)},
+				Hex:       hex.EncodeToString(hashRoot),
+			},
+		},
+		{
+			N:        2,
+			ValueSat: *big.NewInt(0).SetUint64(timeout),
+		},
+	}
 }
 
 func (b *NimiqRPC) nimHeaderToBlockHeader(block *rpcHeader) *bchain.BlockHeader {
@@ -72,21 +223,377 @@ func (b *NimiqRPC) nimHeaderToBlockHeader(block *rpcHeader) *bchain.BlockHeader
 	}
 }
 
+// nimFriendlyAddress converts a raw (hex or already user-friendly) Nimiq
+// address into its user-friendly "NQ" form, falling back to the input
+// unchanged if it cannot be parsed, so a tx is never dropped over a single
+// unparseable address
+func (b *NimiqRPC) nimFriendlyAddress(address string) string {
+	addrDesc, err := b.Parser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return address
+	}
+	addrs, _, err := b.Parser.GetAddressesFromAddrDesc(addrDesc)
+	if err != nil || len(addrs) == 0 {
+		return address
+	}
+	return addrs[0]
+}
+
 func (b *NimiqRPC) nimTxToTx(tx *rpcTx) *bchain.Tx {
+	vout := []bchain.Vout{
+		{
+			N:        0,
+			ValueSat: *big.NewInt(int64(tx.Value)),
+			ScriptPubKey: bchain.ScriptPubKey{
+				Addresses: []string{b.nimFriendlyAddress(tx.To)},
+			},
+		},
+	}
+	vout = append(vout, nimContractVouts(tx)...)
+
 	btx := &bchain.Tx{
-		Txid: tx.Hash,
+		Txid:             tx.Hash,
+		Blocktime:        int64(tx.Timestamp),
+		Time:             int64(tx.Timestamp),
+		Confirmations:    uint32(tx.Confirmations),
+		CoinSpecificData: *tx,
 		Vin: []bchain.Vin{
-			{Addresses: []string{tx.From}},
+			{Addresses: []string{b.nimFriendlyAddress(tx.From)}},
 		},
-		Vout: []bchain.Vout{
-			{
-				N:        0,
-				ValueSat: *big.NewInt(int64(tx.Value)),
-				ScriptPubKey: bchain.ScriptPubKey{
-					Addresses: []string{tx.To},
-				},
+		Vout: vout,
+	}
+	return btx
+}
+
+// nimBase32Encode encodes data using Nimiq's base32 alphabet (no padding)
+func nimBase32Encode(data []byte) string {
+	var sb strings.Builder
+	bits := 0
+	value := 0
+	for _, c := range data {
+		value = (value << 8) | int(c)
+		bits += 8
+		for bits >= 5 {
+			sb.WriteByte(nimAddressAlphabet[(value>>uint(bits-5))&31])
+			bits -= 5
+		}
+	}
+	if bits > 0 {
+		sb.WriteByte(nimAddressAlphabet[(value<<uint(5-bits))&31])
+	}
+	return sb.String()
+}
+
+// nimBase32Decode reverses nimBase32Encode
+func nimBase32Decode(s string) ([]byte, error) {
+	var out []byte
+	bits := 0
+	value := 0
+	for _, c := range s {
+		idx := strings.IndexRune(nimAddressAlphabet, c)
+		if idx < 0 {
+			return nil, errors.Errorf("invalid Nimiq base32 character %q", c)
+		}
+		value = (value << 5) | idx
+		bits += 5
+		if bits >= 8 {
+			out = append(out, byte((value>>uint(bits-8))&0xff))
+			bits -= 8
+		}
+	}
+	return out, nil
+}
+
+// nimIBANCheck computes the ISO 13616 mod-97-10 check digits of s, letters
+// are mapped to two-digit numbers (A=10, B=11, ...) as in a regular IBAN
+func nimIBANCheck(s string) string {
+	var sb strings.Builder
+	for _, c := range strings.ToUpper(s) {
+		if c >= '0' && c <= '9' {
+			sb.WriteRune(c)
+		} else {
+			sb.WriteString(strconv.Itoa(int(c) - 55))
+		}
+	}
+	num := sb.String()
+
+	rem := 0
+	for i := 0; i < len(num); i += 6 {
+		end := i + 6
+		if end > len(num) {
+			end = len(num)
+		}
+		n, _ := strconv.Atoi(strconv.Itoa(rem) + num[i:end])
+		rem = n % 97
+	}
+	return strconv.Itoa(98 - rem)
+}
+
+// formatNimiqAddress encodes a 20-byte address hash as a user-friendly,
+// space-grouped "NQ" IBAN-style address
+func formatNimiqAddress(hash []byte) string {
+	base32 := nimBase32Encode(hash)
+	check := nimIBANCheck(base32 + "NQ00")
+	if len(check) < 2 {
+		check = "0" + check
+	}
+	raw := "NQ" + check + base32
+
+	var groups []string
+	for i := 0; i < len(raw); i += 4 {
+		end := i + 4
+		if end > len(raw) {
+			end = len(raw)
+		}
+		groups = append(groups, raw[i:end])
+	}
+	return strings.Join(groups, " ")
+}
+
+// parseNimiqAddress decodes a user-friendly "NQ" IBAN-style address (with or
+// without the grouping spaces) back to its 20-byte address hash
+func parseNimiqAddress(address string) ([]byte, error) {
+	raw := strings.ToUpper(strings.Replace(address, " ", "", -1))
+	if len(raw) != 36 || !strings.HasPrefix(raw, "NQ") {
+		return nil, errors.Errorf("invalid Nimiq address %q", address)
+	}
+
+	base32 := raw[4:]
+	hash, err := nimBase32Decode(base32)
+	if err != nil {
+		return nil, errors.Annotatef(err, "invalid Nimiq address %q", address)
+	}
+	if len(hash) != NimiqTypeAddressDescriptorLen {
+		return nil, errors.Errorf("invalid Nimiq address %q: unexpected length", address)
+	}
+
+	check := nimIBANCheck(base32 + "NQ00")
+	if len(check) < 2 {
+		check = "0" + check
+	}
+	if raw[2:4] != check {
+		return nil, errors.Errorf("invalid Nimiq address %q: checksum mismatch", address)
+	}
+
+	return hash, nil
+}
+
+// GetAddrDescFromAddress returns internal address representation of given address.
+// It accepts both the raw 20-byte hex form and the user-friendly "NQ" form.
+func (p *NimiqParser) GetAddrDescFromAddress(address string) (bchain.AddressDescriptor, error) {
+	if len(address) == 2*NimiqTypeAddressDescriptorLen {
+		if raw, err := hex.DecodeString(address); err == nil {
+			return bchain.AddressDescriptor(raw), nil
+		}
+	}
+
+	hash, err := parseNimiqAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return bchain.AddressDescriptor(hash), nil
+}
+
+// GetAddrDescFromVout returns internal address representation of given transaction output
+func (p *NimiqParser) GetAddrDescFromVout(output *bchain.Vout) (bchain.AddressDescriptor, error) {
+	if len(output.ScriptPubKey.Addresses) != 1 {
+		return nil, bchain.ErrAddressMissing
+	}
+	return p.GetAddrDescFromAddress(output.ScriptPubKey.Addresses[0])
+}
+
+// GetAddressesFromAddrDesc returns user-friendly addresses for given address descriptor
+func (p *NimiqParser) GetAddressesFromAddrDesc(addrDesc bchain.AddressDescriptor) ([]string, bool, error) {
+	if len(addrDesc) != NimiqTypeAddressDescriptorLen {
+		return nil, false, errors.Errorf("GetAddressesFromAddrDesc: invalid address descriptor of length %d", len(addrDesc))
+	}
+	return []string{formatNimiqAddress(addrDesc)}, true, nil
+}
+
+// PackTx packs the Nimiq-specific fields of rpcTx into a compact,
+// fixed-layout binary record followed by the length-prefixed Data and Proof
+// payloads, used instead of BaseParser's JSON fallback to keep the on-disk
+// transaction records small while still round-tripping contract txs
+func (p *NimiqParser) PackTx(tx *bchain.Tx, height uint32, blockTime int64) ([]byte, error) {
+	nt, ok := tx.CoinSpecificData.(rpcTx)
+	if !ok {
+		return nil, errors.Errorf("PackTx: missing Nimiq tx data for %v", tx.Txid)
+	}
+
+	txHash, err := hex.DecodeString(nt.Hash)
+	if err == nil && len(txHash) != 32 {
+		err = errors.Errorf("length %d, want 32", len(txHash))
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "PackTx: invalid tx hash %v", nt.Hash)
+	}
+	blockHash, err := hex.DecodeString(nt.BlockHash)
+	if err == nil && len(blockHash) != 32 {
+		err = errors.Errorf("length %d, want 32", len(blockHash))
+	}
+	if err != nil {
+		return nil, errors.Annotatef(err, "PackTx: invalid block hash %v", nt.BlockHash)
+	}
+	fromDesc, err := p.GetAddrDescFromAddress(nt.From)
+	if err != nil {
+		return nil, err
+	}
+	toDesc, err := p.GetAddrDescFromAddress(nt.To)
+	if err != nil {
+		return nil, err
+	}
+	data, err := hex.DecodeString(nt.Data)
+	if err != nil {
+		return nil, errors.Annotatef(err, "PackTx: invalid data %v", nt.Data)
+	}
+	proof, err := hex.DecodeString(nt.Proof)
+	if err != nil {
+		return nil, errors.Annotatef(err, "PackTx: invalid proof %v", nt.Proof)
+	}
+
+	buf := make([]byte, 0, nimiqTxFixedRecordLen+2+len(data)+2+len(proof))
+	b4 := make([]byte, 4)
+	b8 := make([]byte, 8)
+
+	binary.BigEndian.PutUint32(b4, height)
+	buf = append(buf, b4...)
+	binary.BigEndian.PutUint64(b8, uint64(blockTime))
+	buf = append(buf, b8...)
+	binary.BigEndian.PutUint32(b4, uint32(nt.Confirmations))
+	buf = append(buf, b4...)
+	binary.BigEndian.PutUint32(b4, uint32(nt.TransactionIndex))
+	buf = append(buf, b4...)
+	binary.BigEndian.PutUint64(b8, nt.Value)
+	buf = append(buf, b8...)
+	binary.BigEndian.PutUint64(b8, nt.Fee)
+	buf = append(buf, b8...)
+	binary.BigEndian.PutUint64(b8, nt.Timestamp)
+	buf = append(buf, b8...)
+	binary.BigEndian.PutUint32(b4, uint32(nt.Flags))
+	buf = append(buf, b4...)
+	binary.BigEndian.PutUint32(b4, uint32(nt.SenderType))
+	buf = append(buf, b4...)
+	binary.BigEndian.PutUint32(b4, uint32(nt.RecipientType))
+	buf = append(buf, b4...)
+	binary.BigEndian.PutUint32(b4, nt.ValidityStartHeight)
+	buf = append(buf, b4...)
+	binary.BigEndian.PutUint32(b4, uint32(nt.NetworkID))
+	buf = append(buf, b4...)
+	buf = append(buf, txHash...)
+	buf = append(buf, blockHash...)
+	buf = append(buf, fromDesc...)
+	buf = append(buf, toDesc...)
+
+	b2 := make([]byte, 2)
+	binary.BigEndian.PutUint16(b2, uint16(len(data)))
+	buf = append(buf, b2...)
+	buf = append(buf, data...)
+	binary.BigEndian.PutUint16(b2, uint16(len(proof)))
+	buf = append(buf, b2...)
+	buf = append(buf, proof...)
+
+	return buf, nil
+}
+
+// UnpackTx reverses PackTx, including re-deriving the contract pseudo-vouts
+// from the stored Data/Flags so already-indexed vesting/HTLC txs keep
+// surfacing their contract participants on every later read
+func (p *NimiqParser) UnpackTx(buf []byte) (*bchain.Tx, uint32, error) {
+	if len(buf) < nimiqTxFixedRecordLen+4 {
+		return nil, 0, errors.Errorf("UnpackTx: record too short (%d bytes)", len(buf))
+	}
+
+	height := binary.BigEndian.Uint32(buf[0:4])
+	blockTime := int64(binary.BigEndian.Uint64(buf[4:12]))
+	confirmations := binary.BigEndian.Uint32(buf[12:16])
+	txIndex := binary.BigEndian.Uint32(buf[16:20])
+	value := binary.BigEndian.Uint64(buf[20:28])
+	fee := binary.BigEndian.Uint64(buf[28:36])
+	timestamp := binary.BigEndian.Uint64(buf[36:44])
+	flags := binary.BigEndian.Uint32(buf[44:48])
+	senderType := binary.BigEndian.Uint32(buf[48:52])
+	recipientType := binary.BigEndian.Uint32(buf[52:56])
+	validityStartHeight := binary.BigEndian.Uint32(buf[56:60])
+	networkID := binary.BigEndian.Uint32(buf[60:64])
+
+	off := 64
+	txHash := buf[off : off+32]
+	off += 32
+	blockHash := buf[off : off+32]
+	off += 32
+	fromDesc := bchain.AddressDescriptor(buf[off : off+NimiqTypeAddressDescriptorLen])
+	off += NimiqTypeAddressDescriptorLen
+	toDesc := bchain.AddressDescriptor(buf[off : off+NimiqTypeAddressDescriptorLen])
+	off += NimiqTypeAddressDescriptorLen
+
+	if off+2 > len(buf) {
+		return nil, 0, errors.New("UnpackTx: truncated data length")
+	}
+	dataLen := int(binary.BigEndian.Uint16(buf[off : off+2]))
+	off += 2
+	if off+dataLen+2 > len(buf) {
+		return nil, 0, errors.New("UnpackTx: truncated data payload")
+	}
+	data := buf[off : off+dataLen]
+	off += dataLen
+
+	proofLen := int(binary.BigEndian.Uint16(buf[off : off+2]))
+	off += 2
+	if off+proofLen > len(buf) {
+		return nil, 0, errors.New("UnpackTx: truncated proof payload")
+	}
+	proof := buf[off : off+proofLen]
+
+	fromAddrs, _, err := p.GetAddressesFromAddrDesc(fromDesc)
+	if err != nil {
+		return nil, 0, err
+	}
+	toAddrs, _, err := p.GetAddressesFromAddrDesc(toDesc)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	nt := rpcTx{
+		Hash:                hex.EncodeToString(txHash),
+		BlockHash:           hex.EncodeToString(blockHash),
+		Timestamp:           timestamp,
+		Confirmations:       int(confirmations),
+		TransactionIndex:    int(txIndex),
+		From:                fromAddrs[0],
+		To:                  toAddrs[0],
+		Value:               value,
+		Fee:                 fee,
+		Flags:               int(flags),
+		Data:                hex.EncodeToString(data),
+		Proof:               hex.EncodeToString(proof),
+		SenderType:          int(senderType),
+		RecipientType:       int(recipientType),
+		ValidityStartHeight: validityStartHeight,
+		NetworkID:           int(networkID),
+	}
+
+	vout := []bchain.Vout{
+		{
+			N:        0,
+			ValueSat: *big.NewInt(0).SetUint64(nt.Value),
+			ScriptPubKey: bchain.ScriptPubKey{
+				Addresses: []string{nt.To},
 			},
 		},
 	}
-	return btx
+	vout = append(vout, nimContractVouts(&nt)...)
+
+	tx := &bchain.Tx{
+		Txid:             nt.Hash,
+		Blocktime:        blockTime,
+		Time:             int64(timestamp),
+		Confirmations:    confirmations,
+		CoinSpecificData: nt,
+		Vin: []bchain.Vin{
+			{Addresses: []string{nt.From}},
+		},
+		Vout: vout,
+	}
+
+	return tx, height, nil
 }
@@ -0,0 +1,266 @@
+package nim
+
+import (
+	"blockbook/bchain"
+	"encoding/binary"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func TestFormatParseNimiqAddress(t *testing.T) {
+	hash, err := hex.DecodeString("a1b2c3d4e5f60708090a0b0c0d0e0f1011121314")
+	if err != nil {
+		t.Fatalf("bad test fixture: %v", err)
+	}
+
+	formatted := formatNimiqAddress(hash)
+	if !strings.HasPrefix(formatted, "NQ") {
+		t.Fatalf("formatNimiqAddress(%x) = %q, want NQ... prefix", hash, formatted)
+	}
+
+	parsed, err := parseNimiqAddress(formatted)
+	if err != nil {
+		t.Fatalf("parseNimiqAddress(%q) failed: %v", formatted, err)
+	}
+	if hex.EncodeToString(parsed) != hex.EncodeToString(hash) {
+		t.Errorf("round trip mismatch: got %x, want %x", parsed, hash)
+	}
+
+	// parsing must also accept the address without its grouping spaces
+	ungrouped := strings.Replace(formatted, " ", "", -1)
+	parsed, err = parseNimiqAddress(ungrouped)
+	if err != nil {
+		t.Fatalf("parseNimiqAddress(%q) failed: %v", ungrouped, err)
+	}
+	if hex.EncodeToString(parsed) != hex.EncodeToString(hash) {
+		t.Errorf("round trip mismatch (ungrouped): got %x, want %x", parsed, hash)
+	}
+
+	// a wrong pair of check digits must be rejected ("00" is never computed,
+	// check digits run from 02 to 98)
+	tampered := "NQ" + "00" + ungrouped[4:]
+	if _, err := parseNimiqAddress(tampered); err == nil {
+		t.Errorf("parseNimiqAddress(%q) succeeded, want checksum error", tampered)
+	}
+}
+
+func TestNimBase32RoundTrip(t *testing.T) {
+	cases := [][]byte{
+		{},
+		{0x00},
+		{0xff},
+		{0x01, 0x02, 0x03, 0x04, 0x05},
+		mustHex(t, "a1b2c3d4e5f60708090a0b0c0d0e0f1011121314"),
+	}
+	for _, data := range cases {
+		encoded := nimBase32Encode(data)
+		decoded, err := nimBase32Decode(encoded)
+		if err != nil {
+			t.Fatalf("nimBase32Decode(%q) failed: %v", encoded, err)
+		}
+		if hex.EncodeToString(decoded) != hex.EncodeToString(data) {
+			t.Errorf("round trip mismatch for %x: encoded %q, decoded back %x", data, encoded, decoded)
+		}
+	}
+}
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatalf("bad test fixture %q: %v", s, err)
+	}
+	return b
+}
+
+func TestPackUnpackTxBasicTransfer(t *testing.T) {
+	p := NewEthereumParser(0)
+
+	fromHex := strings.Repeat("11", NimiqTypeAddressDescriptorLen)
+	toHex := strings.Repeat("22", NimiqTypeAddressDescriptorLen)
+
+	tx := &bchain.Tx{
+		Txid: strings.Repeat("ab", 32),
+		CoinSpecificData: rpcTx{
+			Hash:                strings.Repeat("ab", 32),
+			BlockHash:           strings.Repeat("cd", 32),
+			Timestamp:           1234567890,
+			Confirmations:       10,
+			TransactionIndex:    2,
+			From:                fromHex,
+			To:                  toHex,
+			Value:               100000,
+			Fee:                 138,
+			ValidityStartHeight: 42,
+			NetworkID:           1,
+		},
+	}
+
+	packed, err := p.PackTx(tx, 99, 1600000000)
+	if err != nil {
+		t.Fatalf("PackTx failed: %v", err)
+	}
+
+	unpacked, height, err := p.UnpackTx(packed)
+	if err != nil {
+		t.Fatalf("UnpackTx failed: %v", err)
+	}
+	if height != 99 {
+		t.Errorf("UnpackTx height = %d, want 99", height)
+	}
+
+	nt, ok := unpacked.CoinSpecificData.(rpcTx)
+	if !ok {
+		t.Fatalf("UnpackTx CoinSpecificData is %T, want rpcTx", unpacked.CoinSpecificData)
+	}
+	if nt.Hash != strings.Repeat("ab", 32) {
+		t.Errorf("Hash = %q, want %q", nt.Hash, strings.Repeat("ab", 32))
+	}
+	if nt.Value != 100000 || nt.Fee != 138 {
+		t.Errorf("Value/Fee = %d/%d, want 100000/138", nt.Value, nt.Fee)
+	}
+	if nt.ValidityStartHeight != 42 || nt.NetworkID != 1 {
+		t.Errorf("ValidityStartHeight/NetworkID = %d/%d, want 42/1", nt.ValidityStartHeight, nt.NetworkID)
+	}
+
+	fromDesc, err := p.GetAddrDescFromAddress(nt.From)
+	if err != nil {
+		t.Fatalf("GetAddrDescFromAddress(From) failed: %v", err)
+	}
+	if hex.EncodeToString(fromDesc) != strings.ToLower(fromHex) {
+		t.Errorf("From round trip mismatch: got %x, want %s", fromDesc, fromHex)
+	}
+	toDesc, err := p.GetAddrDescFromAddress(nt.To)
+	if err != nil {
+		t.Fatalf("GetAddrDescFromAddress(To) failed: %v", err)
+	}
+	if hex.EncodeToString(toDesc) != strings.ToLower(toHex) {
+		t.Errorf("To round trip mismatch: got %x, want %s", toDesc, toHex)
+	}
+
+	if len(unpacked.Vout) != 1 {
+		t.Fatalf("Vout = %v, want a single basic vout", unpacked.Vout)
+	}
+}
+
+func TestPackUnpackTxHTLCCreation(t *testing.T) {
+	p := NewEthereumParser(0)
+
+	sender := make([]byte, NimiqTypeAddressDescriptorLen)
+	recipient := bytes(NimiqTypeAddressDescriptorLen, 0x33)
+	hashRoot := bytes(32, 0x44)
+	timeout := uint64(500000)
+
+	data := append([]byte{}, sender...)
+	data = append(data, recipient...)
+	data = append(data, 0x01) // hash algorithm
+	data = append(data, hashRoot...)
+	data = append(data, 0x01) // hash count
+	timeoutBuf := make([]byte, 8)
+	binary.BigEndian.PutUint64(timeoutBuf, timeout)
+	data = append(data, timeoutBuf...)
+
+	fromHex := hex.EncodeToString(bytes(NimiqTypeAddressDescriptorLen, 0x11))
+	toHex := hex.EncodeToString(bytes(NimiqTypeAddressDescriptorLen, 0x22))
+
+	tx := &bchain.Tx{
+		CoinSpecificData: rpcTx{
+			Hash:          strings.Repeat("ab", 32),
+			BlockHash:     strings.Repeat("cd", 32),
+			From:          fromHex,
+			To:            toHex,
+			Value:         5000,
+			Flags:         nimFlagContractCreation,
+			RecipientType: nimAccountTypeHTLC,
+			Data:          hex.EncodeToString(data),
+		},
+	}
+
+	packed, err := p.PackTx(tx, 1, 0)
+	if err != nil {
+		t.Fatalf("PackTx failed: %v", err)
+	}
+	unpacked, _, err := p.UnpackTx(packed)
+	if err != nil {
+		t.Fatalf("UnpackTx failed: %v", err)
+	}
+
+	nt, ok := unpacked.CoinSpecificData.(rpcTx)
+	if !ok {
+		t.Fatalf("UnpackTx CoinSpecificData is %T, want rpcTx", unpacked.CoinSpecificData)
+	}
+	if nt.Data != hex.EncodeToString(data) {
+		t.Errorf("Data round trip mismatch: got %s, want %s", nt.Data, hex.EncodeToString(data))
+	}
+
+	// basic vout + recipient/hashRoot vout + timeout vout
+	if len(unpacked.Vout) != 3 {
+		t.Fatalf("Vout = %v, want 3 entries (basic + HTLC recipient + timeout)", unpacked.Vout)
+	}
+	want := formatNimiqAddress(recipient)
+	got := unpacked.Vout[1].ScriptPubKey.Addresses[0]
+	if got != want {
+		t.Errorf("HTLC recipient vout address = %q, want %q", got, want)
+	}
+	if unpacked.Vout[1].ScriptPubKey.Hex != hex.EncodeToString(hashRoot) {
+		t.Errorf("HTLC hashRoot vout = %q, want %q", unpacked.Vout[1].ScriptPubKey.Hex, hex.EncodeToString(hashRoot))
+	}
+	if unpacked.Vout[2].ValueSat.Uint64() != timeout {
+		t.Errorf("HTLC timeout vout = %d, want %d", unpacked.Vout[2].ValueSat.Uint64(), timeout)
+	}
+}
+
+func TestPackUnpackTxHTLCRedemptionProof(t *testing.T) {
+	p := NewEthereumParser(0)
+
+	hashRoot := bytes(32, 0x55)
+	proof := append([]byte{nimHTLCProofRegularTransfer, 0x01, 0x01}, hashRoot...)
+
+	fromHex := hex.EncodeToString(bytes(NimiqTypeAddressDescriptorLen, 0x11))
+	toHex := hex.EncodeToString(bytes(NimiqTypeAddressDescriptorLen, 0x22))
+
+	tx := &bchain.Tx{
+		CoinSpecificData: rpcTx{
+			Hash:       strings.Repeat("ab", 32),
+			BlockHash:  strings.Repeat("cd", 32),
+			From:       fromHex,
+			To:         toHex,
+			Value:      5000,
+			SenderType: nimAccountTypeHTLC,
+			Proof:      hex.EncodeToString(proof),
+		},
+	}
+
+	packed, err := p.PackTx(tx, 1, 0)
+	if err != nil {
+		t.Fatalf("PackTx failed: %v", err)
+	}
+	unpacked, _, err := p.UnpackTx(packed)
+	if err != nil {
+		t.Fatalf("UnpackTx failed: %v", err)
+	}
+
+	nt, ok := unpacked.CoinSpecificData.(rpcTx)
+	if !ok {
+		t.Fatalf("UnpackTx CoinSpecificData is %T, want rpcTx", unpacked.CoinSpecificData)
+	}
+	if nt.Proof != hex.EncodeToString(proof) {
+		t.Errorf("Proof round trip mismatch: got %s, want %s", nt.Proof, hex.EncodeToString(proof))
+	}
+
+	if len(unpacked.Vout) != 2 {
+		t.Fatalf("Vout = %v, want basic vout + redeemed hashRoot vout", unpacked.Vout)
+	}
+	if unpacked.Vout[1].ScriptPubKey.Hex != hex.EncodeToString(hashRoot) {
+		t.Errorf("redeemed hashRoot vout = %q, want %q", unpacked.Vout[1].ScriptPubKey.Hex, hex.EncodeToString(hashRoot))
+	}
+}
+
+func bytes(n int, fill byte) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = fill
+	}
+	return b
+}
@@ -10,9 +10,31 @@ import (
 	"github.com/juju/errors"
 	"github.com/terorie/gimiq/networks"
 	"math/big"
+	"strings"
+	"sync"
 	"time"
 )
 
+// nimSenderVout is the synthetic Vout used to index the sender side of a
+// value transfer in the mempool address index, since Nimiq is account-based
+// and has no real sender outpoint to point to
+const nimSenderVout = -1
+
+// nimSubscribeNamespace is the JSON-RPC namespace Nimiq nodes expose their
+// pub/sub methods under, subscriptions are issued as "<namespace>_subscribe"
+const nimSubscribeNamespace = "nimiq"
+
+// nimMinReconnectBackoff and nimMaxReconnectBackoff bound the exponential
+// backoff used to reconnect a dropped websocket subscription
+const (
+	nimMinReconnectBackoff = time.Second
+	nimMaxReconnectBackoff = time.Minute
+)
+
+// nimPollInterval is used for the plain-HTTP fallback when no websocket
+// push notifications are available
+const nimPollInterval = 10 * time.Second
+
 // NimiqNet type specifies the type of Nimiq network
 type NimiqNet uint8
 
@@ -38,6 +60,13 @@ type NimiqRPC struct {
 	rpc         *rpc.Client
 	timeout     time.Duration
 	ChainConfig *Configuration
+	pushHandler func(bchain.NotificationType)
+	isWebsocket bool
+
+	mempoolMux   sync.RWMutex
+	mempoolTxs   map[string]*bchain.Tx
+	mempoolRaw   map[string]*rpcTx
+	mempoolAddrs map[string][]bchain.Outpoint
 }
 
 func NewNimiqRPC(config json.RawMessage, pushHandler func(bchain.NotificationType)) (bchain.BlockChain, error) {
@@ -51,7 +80,15 @@ func NewNimiqRPC(config json.RawMessage, pushHandler func(bchain.NotificationTyp
 	if c.BlockAddressesToKeep < 100 {
 		c.BlockAddressesToKeep = 100
 	}
-	rc, err := rpc.Dial(c.RPCURL)
+
+	isWebsocket := strings.HasPrefix(c.RPCURL, "ws://") || strings.HasPrefix(c.RPCURL, "wss://")
+
+	var rc *rpc.Client
+	if isWebsocket {
+		rc, err = rpc.DialWebsocket(context.Background(), c.RPCURL, "")
+	} else {
+		rc, err = rpc.Dial(c.RPCURL)
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -61,6 +98,12 @@ func NewNimiqRPC(config json.RawMessage, pushHandler func(bchain.NotificationTyp
 		rpc:         rc,
 		ChainConfig: &c,
 		timeout:     time.Duration(c.RPCTimeout) * time.Second,
+		pushHandler: pushHandler,
+		isWebsocket: isWebsocket,
+
+		mempoolTxs:   make(map[string]*bchain.Tx),
+		mempoolRaw:   make(map[string]*rpcTx),
+		mempoolAddrs: make(map[string][]bchain.Outpoint),
 	}
 
 	return s, nil
@@ -91,9 +134,90 @@ func (b *NimiqRPC) Initialize() error {
 	}
 	glog.Info("rpc: block chain ", b.Network)
 
+	if b.pushHandler != nil {
+		if b.isWebsocket {
+			go b.subscribeEvents()
+		} else {
+			go b.pollNewBlocks()
+		}
+	}
+
 	return nil
 }
 
+// subscribeEvents subscribes to headChange and transactions notifications
+// over the websocket connection and fans them out to pushHandler, it
+// reconnects with an exponential backoff if the subscriptions drop
+func (b *NimiqRPC) subscribeEvents() {
+	backoff := nimMinReconnectBackoff
+	resetBackoff := func() { backoff = nimMinReconnectBackoff }
+	for {
+		err := b.subscribeEventsOnce(resetBackoff)
+		if err != nil {
+			glog.Error("nim: subscribeEvents: ", err)
+		}
+		glog.Infof("nim: reconnecting websocket subscriptions in %s", backoff)
+		time.Sleep(backoff)
+		backoff *= 2
+		if backoff > nimMaxReconnectBackoff {
+			backoff = nimMaxReconnectBackoff
+		}
+	}
+}
+
+// subscribeEventsOnce establishes both subscriptions and blocks fanning out
+// events until one of them fails. onSubscribed is called once both
+// subscriptions are up, so the caller can reset its reconnect backoff
+func (b *NimiqRPC) subscribeEventsOnce(onSubscribed func()) error {
+	headCh := make(chan json.RawMessage)
+	headSub, err := b.rpc.Subscribe(context.Background(), nimSubscribeNamespace, headCh, "headChange")
+	if err != nil {
+		return errors.Annotate(err, "headChange subscription")
+	}
+	defer headSub.Unsubscribe()
+
+	txCh := make(chan json.RawMessage)
+	txSub, err := b.rpc.Subscribe(context.Background(), nimSubscribeNamespace, txCh, "transactions")
+	if err != nil {
+		return errors.Annotate(err, "transactions subscription")
+	}
+	defer txSub.Unsubscribe()
+
+	onSubscribed()
+
+	for {
+		select {
+		case <-headCh:
+			b.pushHandler(bchain.NotificationNewBlock)
+		case <-txCh:
+			b.pushHandler(bchain.NotificationNewTx)
+		case err := <-headSub.Err():
+			return err
+		case err := <-txSub.Err():
+			return err
+		}
+	}
+}
+
+// pollNewBlocks is the plain-HTTP fallback for push notifications, it polls
+// the current height and notifies on every change
+func (b *NimiqRPC) pollNewBlocks() {
+	var lastHeight uint32
+	ticker := time.NewTicker(nimPollInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		height, err := b.GetBestBlockHeight()
+		if err != nil {
+			glog.Warning("nim: pollNewBlocks: ", err)
+			continue
+		}
+		if height != lastHeight {
+			lastHeight = height
+			b.pushHandler(bchain.NotificationNewBlock)
+		}
+	}
+}
+
 // GetCoinName returns coin name
 func (b *NimiqRPC) GetCoinName() string {
 	return b.ChainConfig.CoinName
@@ -104,11 +228,98 @@ func (b *NimiqRPC) GetSubversion() string {
 	return ""
 }
 
+// rpcInfo holds the subset of the optional getInfo RPC used to populate
+// Version/Subversion in GetChainInfo, not every Nimiq node exposes it
+type rpcInfo struct {
+	ClientVersion string `json:"clientVersion"`
+}
+
 // GetChainInfo returns information about the connected backend
 func (b *NimiqRPC) GetChainInfo() (*bchain.ChainInfo, error) {
-	_, cancel := context.WithTimeout(context.Background(), b.timeout)
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
 	defer cancel()
-	return nil, errors.New("not implemented")
+
+	// head's height is needed to fetch head itself, so blockNumber can't run
+	// concurrently with the getBlockByNumber call below
+	var blocks uint32
+	blocksErr := b.rpc.CallContext(ctx, &blocks, "blockNumber")
+	if blocksErr != nil {
+		glog.Warning("nim: GetChainInfo: ", blocksErr)
+	}
+
+	var (
+		consensus                                       string
+		peerCount                                       int
+		syncing                                         bool
+		head                                            *rpcHeader
+		consensusErr, peerCountErr, syncingErr, headErr error
+	)
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		consensusErr = b.rpc.CallContext(ctx, &consensus, "consensus")
+	}()
+	go func() {
+		defer wg.Done()
+		peerCountErr = b.rpc.CallContext(ctx, &peerCount, "peerCount")
+	}()
+	go func() {
+		defer wg.Done()
+		syncingErr = b.rpc.CallContext(ctx, &syncing, "syncing")
+	}()
+	go func() {
+		defer wg.Done()
+		if blocksErr != nil {
+			// blocks is meaningless without a real height, don't let
+			// getBlockByNumber(0, ...) quietly resolve to the genesis block
+			return
+		}
+		headErr = b.rpc.CallContext(ctx, &head, "getBlockByNumber", blocks, false)
+	}()
+	wg.Wait()
+
+	for _, err := range []error{consensusErr, peerCountErr, syncingErr, headErr} {
+		if err != nil {
+			glog.Warning("nim: GetChainInfo: ", err)
+		}
+	}
+
+	// getInfo is not implemented by every Nimiq node, Version/Subversion stay empty if it fails
+	var info rpcInfo
+	if err := b.rpc.CallContext(ctx, &info, "getInfo"); err != nil {
+		info = rpcInfo{}
+	}
+
+	if consensusErr != nil {
+		// fall back to a coarser consensus state derived from syncing/peerCount
+		switch {
+		case syncingErr == nil && syncing:
+			consensus = "syncing"
+		case peerCountErr == nil && peerCount > 0:
+			consensus = "established"
+		default:
+			consensus = "lost"
+		}
+	}
+
+	rv := &bchain.ChainInfo{
+		Chain:   b.Network,
+		Blocks:  int(blocks),
+		Headers: int(blocks),
+		// Consensus is the same interface{} status field the Ethereum-type
+		// backend already reports sync progress through, not a new export
+		Consensus:  consensus,
+		Version:    info.ClientVersion,
+		Subversion: info.ClientVersion,
+	}
+	if blocksErr == nil && headErr == nil && head != nil {
+		rv.Bestblockhash = head.Hash
+		rv.Difficulty = head.Difficulty
+	}
+
+	return rv, nil
 }
 
 // Shutdown cleans up rpc interface to Nimiq
@@ -262,7 +473,13 @@ func (b *NimiqRPC) GetBlockInfo(hash string) (*bchain.BlockInfo, error) {
 // GetTransactionForMempool returns a transaction by the transaction ID.
 // It could be optimized for mempool, i.e. without block time and confirmations
 func (b *NimiqRPC) GetTransactionForMempool(txid string) (*bchain.Tx, error) {
-	return nil, errors.New("GetTransactionForMempool: not supported")
+	b.mempoolMux.RLock()
+	tx, found := b.mempoolTxs[txid]
+	b.mempoolMux.RUnlock()
+	if !found {
+		return nil, bchain.ErrTxNotFound
+	}
+	return tx, nil
 }
 
 // GetTransaction returns a transaction by the transaction ID.
@@ -282,7 +499,16 @@ func (b *NimiqRPC) GetTransaction(txid string) (*bchain.Tx, error) {
 
 // GetTransactionSpecific returns json as returned by backend, with all coin specific data
 func (b *NimiqRPC) GetTransactionSpecific(tx *bchain.Tx) (json.RawMessage, error) {
-	return nil, errors.New("GetTransactionSpecific: not supported")
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+	var raw json.RawMessage
+	err := b.rpc.CallContext(ctx, &raw, "getTransactionByHash", tx.Txid)
+	if err != nil {
+		return nil, err
+	} else if raw == nil {
+		return nil, bchain.ErrTxNotFound
+	}
+	return raw, nil
 }
 
 // GetMempool returns transactions in mempool
@@ -322,22 +548,95 @@ func (b *NimiqRPC) SendRawTransaction(hex string) (string, error) {
 // ResyncMempool is not reentrant, it should be called from a single thread.
 // Return value is number of transactions in mempool
 func (b *NimiqRPC) ResyncMempool(onNewTxAddr bchain.OnNewTxAddrFunc) (int, error) {
-	return 0, errors.New("not implemented")
+	ctx, cancel := context.WithTimeout(context.Background(), b.timeout)
+	defer cancel()
+
+	var raw []json.RawMessage
+	if err := b.rpc.CallContext(ctx, &raw, "mempoolContent", true); err != nil {
+		return 0, err
+	}
+
+	newTxs := make(map[string]*bchain.Tx, len(raw))
+	newRaw := make(map[string]*rpcTx, len(raw))
+	newAddrs := make(map[string][]bchain.Outpoint, len(raw))
+
+	b.mempoolMux.Lock()
+	defer b.mempoolMux.Unlock()
+
+	for _, r := range raw {
+		tx := new(rpcTx)
+		if err := json.Unmarshal(r, tx); err != nil {
+			glog.Warning("nim: ResyncMempool: ", err)
+			continue
+		}
+
+		btx := b.nimTxToTx(tx)
+		_, existed := b.mempoolTxs[tx.Hash]
+		newTxs[tx.Hash] = btx
+		newRaw[tx.Hash] = tx
+
+		fromDesc, fromErr := b.Parser.GetAddrDescFromAddress(tx.From)
+		if fromErr == nil {
+			key := string(fromDesc)
+			newAddrs[key] = append(newAddrs[key], bchain.Outpoint{Txid: tx.Hash, Vout: nimSenderVout})
+		}
+		toDesc, toErr := b.Parser.GetAddrDescFromAddress(tx.To)
+		if toErr == nil {
+			key := string(toDesc)
+			newAddrs[key] = append(newAddrs[key], bchain.Outpoint{Txid: tx.Hash, Vout: 0})
+		}
+
+		if !existed && onNewTxAddr != nil {
+			if fromErr == nil {
+				if err := onNewTxAddr(btx, fromDesc); err != nil {
+					glog.Warning("nim: onNewTxAddr ", tx.Hash, ": ", err)
+				}
+			}
+			if toErr == nil {
+				if err := onNewTxAddr(btx, toDesc); err != nil {
+					glog.Warning("nim: onNewTxAddr ", tx.Hash, ": ", err)
+				}
+			}
+		}
+	}
+
+	b.mempoolTxs = newTxs
+	b.mempoolRaw = newRaw
+	b.mempoolAddrs = newAddrs
+
+	return len(newTxs), nil
 }
 
 // GetMempoolTransactions returns slice of mempool transactions for given address
 func (b *NimiqRPC) GetMempoolTransactions(address string) ([]bchain.Outpoint, error) {
-	return nil, errors.New("GetMempoolTransactions: not supported")
+	addrDesc, err := b.Parser.GetAddrDescFromAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	return b.GetMempoolTransactionsForAddrDesc(addrDesc)
 }
 
 // GetMempoolTransactionsForAddrDesc returns slice of mempool transactions for given address descriptor
 func (b *NimiqRPC) GetMempoolTransactionsForAddrDesc(addrDesc bchain.AddressDescriptor) ([]bchain.Outpoint, error) {
-	return nil, errors.New("GetMempoolTransactionsForAddrDesc: not supported")
+	b.mempoolMux.RLock()
+	defer b.mempoolMux.RUnlock()
+	return b.mempoolAddrs[string(addrDesc)], nil
 }
 
-// GetMempoolEntry is not supported by Nimiq
+// GetMempoolEntry synthesizes a mempool entry from the fee and timestamp the
+// Nimiq node reported for the transaction, Nimiq itself has no equivalent
+// getmempoolentry RPC
 func (b *NimiqRPC) GetMempoolEntry(txid string) (*bchain.MempoolEntry, error) {
-	return nil, errors.New("GetMempoolEntry: not supported")
+	b.mempoolMux.RLock()
+	tx, found := b.mempoolRaw[txid]
+	b.mempoolMux.RUnlock()
+	if !found {
+		return nil, bchain.ErrTxNotFound
+	}
+	return &bchain.MempoolEntry{
+		FeeSat: *big.NewInt(0).SetUint64(tx.Fee),
+		Time:   int64(tx.Timestamp),
+	}, nil
 }
 
 // GetChainParser returns Nimiq BlockChainParser